@@ -8,10 +8,14 @@ package di
 import (
 	"fmt"
 	"reflect"
+	"strings"
+	"sync"
 )
 
 const injectTag = "inject"
 
+var errorType = reflect.TypeOf((*error)(nil)).Elem()
+
 // Container is a dependency injection (DI) container based on type mapping.
 //
 // Using Container involves two steps. First, register values, types, or providers with the types
@@ -54,6 +58,18 @@ const injectTag = "inject"
 //
 // Note that when building an unregistered type, zero value will be returned. If the type is a struct,
 // the zero value will be further injected by Inject() for those fields tagged with "inject".
+//
+// A type may have more than one binding, distinguished by name: see RegisterNamed, RegisterAsNamed,
+// RegisterProviderNamed and MakeNamed. The unnamed binding registered by Register/RegisterAs/RegisterProvider
+// is simply the binding registered under the empty name, and an `inject` tag whose value is neither
+// empty nor "true" selects the binding registered under that value, e.g. `inject:"primary"`.
+//
+// An inject-tagged field whose type is a zero-argument func returning (T) or (T, error) is treated
+// as a lazy factory rather than a value to build immediately: the field is set to a func that
+// builds T each time it is called, instead of T being built along with the rest of the
+// struct. This defers the cost of building T until it is actually needed, and lets a factory field
+// stand in for a dependency that would otherwise cycle back to the struct being built, since the
+// container only needs to resolve T if the factory is actually invoked.
 type Container interface {
 	// ParentContainer returns the parent container, if any.
 	ParentContainer() Container
@@ -67,6 +83,10 @@ type Container interface {
 
 	// Register registers the specified value and associates it with the type of the value.
 	Register(interface{})
+	// RegisterNamed is the named counterpart of Register: it registers val under the given
+	// name instead of the default (empty-name) binding, allowing multiple values of the same
+	// type to be registered and later distinguished via an `inject:"name"` tag or MakeNamed.
+	RegisterNamed(name string, val interface{})
 	// RegisterAs registers the specified value or type, and associates it with the specified type.
 	// For example,
 	//
@@ -76,41 +96,157 @@ type Container interface {
 	//   // register the Foo type as the Bar interface
 	//   c.RegisterAs(reflect.TypeOf(&Foo{}), di.InterfaceOf((*Bar)(nil)))
 	RegisterAs(interface{}, reflect.Type)
+	// RegisterAsE is the error-returning counterpart of RegisterAs. Instead of panicking when
+	// val cannot be converted to t, it returns an error describing the mismatch.
+	RegisterAsE(val interface{}, t reflect.Type) error
+	// RegisterAsNamed is the named counterpart of RegisterAs.
+	RegisterAsNamed(name string, val interface{}, t reflect.Type)
 	// RegisterProvider registers the provider and associates it with the specified type.
 	// When injecting or making a value for the type, the provider will be called and
 	// its return value will be used as the value of the requested type. If shared is true,
 	// the provider will only be called once, and its return value will be kept and used for
 	// every injection request.
 	RegisterProvider(p Provider, t reflect.Type, shared bool)
+	// RegisterProviderE is the error-returning counterpart of RegisterProvider.
+	RegisterProviderE(p Provider, t reflect.Type, shared bool) error
+	// RegisterProviderNamed is the named counterpart of RegisterProvider.
+	RegisterProviderNamed(name string, p Provider, t reflect.Type, shared bool)
+	// RegisterConstructor registers fn and associates it with the specified type. fn may be any
+	// function whose parameters are themselves resolved from the container, exactly as Call
+	// does; its parameters therefore never need to be built by hand. fn must return either a
+	// single value convertible to t, or such a value plus an error, e.g.
+	//
+	//   c.RegisterConstructor(func(db *sql.DB) (*UserRepo, error) {
+	//       return NewUserRepo(db)
+	//   }, reflect.TypeOf(&UserRepo{}), true)
+	//
+	// This avoids having to write the Provider boilerplate of resolving each dependency via
+	// Make() by hand. As with RegisterProvider, if shared is true fn is only called once and
+	// its result is kept and reused for every subsequent resolution of t.
+	RegisterConstructor(fn interface{}, t reflect.Type, shared bool)
+	// RegisterConstructorE is the error-returning counterpart of RegisterConstructor.
+	RegisterConstructorE(fn interface{}, t reflect.Type, shared bool) error
+	// Provide is a convenience wrapper around RegisterConstructor that infers t from the type
+	// of fn's first return value, for the common case where fn already returns the exact type
+	// it should be bound to. The registration is not shared; use RegisterConstructor directly
+	// to share the constructed value across resolutions.
+	Provide(fn interface{})
+	// ProvideE is the error-returning counterpart of Provide.
+	ProvideE(fn interface{}) error
 
 	// Call calls the specified function/method by injecting all its parameters.
 	// The function/method result is returned as a slice.
 	Call(interface{}) []interface{}
+	// Invoke is the error-returning counterpart of Call. Rather than panicking when f is not
+	// a function or one of its parameters cannot be resolved, it returns the error describing
+	// the failure.
+	Invoke(f interface{}) ([]interface{}, error)
 	// Inject injects the exported fields tagged with "inject" of the given struct.
 	// Note that the struct should be passed as a pointer, or the fields won't be injected.
 	Inject(interface{})
+	// Apply is the error-returning counterpart of Inject. Unlike Inject, which silently leaves
+	// a field as its zero value when it cannot be resolved, Apply reports the failure as an
+	// error that identifies the field path and type that could not be resolved, e.g.
+	// "di: cannot resolve field Controller.Request.Bar (di.Bar): no binding and type is interface".
+	Apply(val interface{}) error
 	// Make returns an instance of the specified type. If the instance is a newly created struct, its fields
 	// will be injected by calling Inject(). Note that Make does not always create a new instance. If the type
 	// has been registered and is associated with a value, that value will be returned.
 	Make(reflect.Type) interface{}
+	// MakeE is the error-returning counterpart of Make. See Apply for how resolution failures
+	// are reported.
+	MakeE(reflect.Type) (interface{}, error)
+	// MakeNamed is the named counterpart of Make: it resolves the binding registered under name
+	// instead of the default (empty-name) binding.
+	MakeNamed(name string, t reflect.Type) interface{}
 }
 
 // Provider is a function for creating a new instance of the associated type.
 type Provider func(Container) reflect.Value
 
+// ResolveError is returned by the error-returning API (Apply, Invoke, MakeE, ...) when a type
+// or struct field could not be resolved. Path is the dotted field path that was being resolved,
+// e.g. "Controller.Request.Bar", in which a function parameter resolved by Invoke or by a
+// constructor appears as "paramN"; it is empty when the failure is for a type requested directly
+// (e.g. via MakeE or a lazy factory field), rather than for a struct field encountered while
+// building a dependency.
+type ResolveError struct {
+	Type   reflect.Type
+	Path   string
+	Reason string
+}
+
+func (e *ResolveError) Error() string {
+	if e.Path == "" {
+		return fmt.Sprintf("di: cannot resolve %v: %s", e.Type, e.Reason)
+	}
+	return fmt.Sprintf("di: cannot resolve field %s (%v): %s", e.Path, e.Type, e.Reason)
+}
+
+// CycleError is returned (or, from the legacy panic-based API, converted to a panic) when
+// resolving a type requires resolving that same type again further down the same resolution
+// chain, e.g. two struct types whose inject-tagged fields reference each other with neither
+// having a concrete registration. Chain lists the types in the order they were being resolved,
+// ending with the type that closed the cycle.
+type CycleError struct {
+	Chain []reflect.Type
+}
+
+func (e *CycleError) Error() string {
+	names := make([]string, len(e.Chain))
+	for i, t := range e.Chain {
+		names[i] = t.String()
+	}
+	return "di: cycle detected: " + strings.Join(names, " -> ")
+}
+
+// cycleIn reports the in-progress resolution chain as a *CycleError if t is already on stack,
+// i.e. resolving t would require resolving t again before the first attempt completes.
+func cycleIn(stack []reflect.Type, t reflect.Type) *CycleError {
+	for _, st := range stack {
+		if st == t {
+			return &CycleError{Chain: append(append([]reflect.Type{}, stack...), t)}
+		}
+	}
+	return nil
+}
+
+// providerBinding is the binding created by RegisterProvider. once guards a shared provider so
+// that, even when multiple goroutines resolve t concurrently, provider runs exactly once; it is
+// nil when shared is false, since a non-shared provider is meant to run on every resolution.
 type providerBinding struct {
 	provider Provider
 	shared   bool
+	once     *sync.Once
+}
+
+// constructorBinding is the binding created by RegisterConstructor: fn is resolved the same way
+// Call resolves a function's parameters, and its result is bound to the registered type. once
+// plays the same role as providerBinding.once; errp records a shared constructor's error (if
+// any) so that every caller waiting on once, not just the one that ran fn, sees it.
+type constructorBinding struct {
+	fn     reflect.Value
+	shared bool
+	once   *sync.Once
+	errp   *error
 }
 
 type container struct {
+	// mu guards parent and values against concurrent registration and resolution. It is only held
+	// inside short accessors such as parentOf, lookup and bind, never while a provider or
+	// constructor func is running, so such a func may itself resolve other types from c.
+	mu     sync.RWMutex
 	parent Container
-	values map[reflect.Type]interface{}
+	// values maps a type to its bindings, keyed by binding name. The empty name is the
+	// default/unnamed binding used by Register, RegisterAs, RegisterProvider, Make, and plain
+	// `inject:"true"` tags.
+	values map[reflect.Type]map[string]interface{}
 }
 
-// NewContainer creates a new Dependency Injection (DI) container.
+// NewContainer creates a new Dependency Injection (DI) container. A Container is safe for
+// concurrent use by multiple goroutines.
 func NewContainer() Container {
-	return &container{values: make(map[reflect.Type]interface{})}
+	return &container{values: make(map[reflect.Type]map[string]interface{})}
 }
 
 // InterfaceOf is a helper method for turning an interface pointer into an interface reflection type.
@@ -132,109 +268,368 @@ func InterfaceOf(iface interface{}) reflect.Type {
 	return t
 }
 
+// bindingName returns the binding name selected by an `inject` tag value: "" and "true" both
+// select the default (unnamed) binding, preserving the original tag semantics; any other value
+// names the binding to resolve from.
+func bindingName(tag string) string {
+	if tag == "true" {
+		return ""
+	}
+	return tag
+}
+
+// isLazyFactory reports whether ft is a signature inject() and injectE() will treat as a lazy
+// factory field rather than a directly-built value: a zero-argument func returning either (T) or
+// (T, error).
+func isLazyFactory(ft reflect.Type) bool {
+	if ft.Kind() != reflect.Func || ft.NumIn() != 0 {
+		return false
+	}
+	switch ft.NumOut() {
+	case 1:
+		return true
+	case 2:
+		return ft.Out(1) == errorType
+	default:
+		return false
+	}
+}
+
+// lazyFactory synthesizes the value for a func() T or func() (T, error) field tagged for
+// injection: rather than building T when the enclosing struct is built, it returns a func that
+// builds T each time it is called, using a fresh resolution unrelated to whatever
+// struct is being built around it. This defers T's cost until it is needed and lets a factory
+// field stand in for a dependency that would otherwise form a cycle with its container, since the
+// cycle is only real if the factory is actually invoked. A (T, error) factory resolves T with the
+// error-returning API, surfacing a failure as its error result instead of a panic; a plain T
+// factory resolves T exactly as build/inject would, including the zero-value fallback for an
+// unregistered interface.
+func (c *container) lazyFactory(ft reflect.Type, name string) reflect.Value {
+	out := ft.Out(0)
+	hasErr := ft.NumOut() == 2
+	return reflect.MakeFunc(ft, func([]reflect.Value) []reflect.Value {
+		if !hasErr {
+			return []reflect.Value{c.buildNamed(out, name, nil)}
+		}
+		v, err := c.buildNamedE(out, name, "", nil)
+		if err != nil {
+			return []reflect.Value{reflect.Zero(out), reflect.ValueOf(err)}
+		}
+		return []reflect.Value{v, reflect.Zero(errorType)}
+	})
+}
+
 func (c *container) ParentContainer() Container {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
 	return c.parent
 }
 
 func (c *container) SetParentContainer(parent Container) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
 	c.parent = parent
 }
 
+// parentOf returns the parent container, if any, as a *container, under a read lock.
+func (c *container) parentOf() *container {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if c.parent == nil {
+		return nil
+	}
+	return c.parent.(*container)
+}
+
 func (c *container) HasRegistered(t reflect.Type) bool {
-	_, ok := c.values[t]
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	_, ok := c.values[t][""]
 	return ok
 }
 
 func (c *container) Unregister(t reflect.Type) {
-	delete(c.values, t)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.values[t], "")
+}
+
+// bind stores val as the binding named name for type t, creating the per-type binding map on
+// first use.
+func (c *container) bind(t reflect.Type, name string, val interface{}) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	m, ok := c.values[t]
+	if !ok {
+		m = make(map[string]interface{})
+		c.values[t] = m
+	}
+	m[name] = val
+}
+
+// lookup returns the binding named name for type t, if any, under a read lock.
+func (c *container) lookup(t reflect.Type, name string) (interface{}, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	val, ok := c.values[t][name]
+	return val, ok
 }
 
 func (c *container) Register(val interface{}) {
-	c.values[reflect.TypeOf(val)] = reflect.ValueOf(val)
+	c.bind(reflect.TypeOf(val), "", reflect.ValueOf(val))
+}
+
+func (c *container) RegisterNamed(name string, val interface{}) {
+	c.bind(reflect.TypeOf(val), name, reflect.ValueOf(val))
 }
 
 func (c *container) RegisterAs(val interface{}, t reflect.Type) {
+	if err := c.RegisterAsE(val, t); err != nil {
+		panic(err.Error())
+	}
+}
+
+func (c *container) RegisterAsE(val interface{}, t reflect.Type) error {
+	return c.registerAs("", val, t)
+}
+
+func (c *container) RegisterAsNamed(name string, val interface{}, t reflect.Type) {
+	if err := c.registerAs(name, val, t); err != nil {
+		panic(err.Error())
+	}
+}
+
+func (c *container) registerAs(name string, val interface{}, t reflect.Type) error {
 	if vt, ok := val.(reflect.Type); ok {
 		// val is a type
 		if !vt.ConvertibleTo(t) {
-			panic(fmt.Sprintf("%v cannot be converted to %v", vt, t))
+			return fmt.Errorf("di: %v cannot be converted to %v", vt, t)
 		}
-		c.values[t] = vt
-		return
+		c.bind(t, name, vt)
+		return nil
 	}
 
 	vt := reflect.TypeOf(val)
 	if !vt.ConvertibleTo(t) {
-		panic(fmt.Sprintf("%v cannot be converted to %v", vt, t))
+		return fmt.Errorf("di: %v cannot be converted to %v", vt, t)
 	}
-	c.values[t] = reflect.ValueOf(val)
+	c.bind(t, name, reflect.ValueOf(val))
+	return nil
 }
 
 func (c *container) RegisterProvider(p Provider, t reflect.Type, shared bool) {
-	c.values[t] = providerBinding{p, shared}
+	if err := c.RegisterProviderE(p, t, shared); err != nil {
+		panic(err.Error())
+	}
+}
+
+func (c *container) RegisterProviderE(p Provider, t reflect.Type, shared bool) error {
+	return c.registerProvider("", p, t, shared)
+}
+
+func (c *container) RegisterProviderNamed(name string, p Provider, t reflect.Type, shared bool) {
+	if err := c.registerProvider(name, p, t, shared); err != nil {
+		panic(err.Error())
+	}
+}
+
+func (c *container) registerProvider(name string, p Provider, t reflect.Type, shared bool) error {
+	if p == nil {
+		return fmt.Errorf("di: provider for %v must not be nil", t)
+	}
+	var once *sync.Once
+	if shared {
+		once = &sync.Once{}
+	}
+	c.bind(t, name, providerBinding{p, shared, once})
+	return nil
+}
+
+func (c *container) RegisterConstructor(fn interface{}, t reflect.Type, shared bool) {
+	if err := c.RegisterConstructorE(fn, t, shared); err != nil {
+		panic(err.Error())
+	}
+}
+
+func (c *container) RegisterConstructorE(fn interface{}, t reflect.Type, shared bool) error {
+	fv := reflect.ValueOf(fn)
+	ft := fv.Type()
+	if ft.Kind() != reflect.Func {
+		return fmt.Errorf("di: RegisterConstructor requires a func, got %v", ft)
+	}
+	switch ft.NumOut() {
+	case 1:
+	case 2:
+		if !ft.Out(1).Implements(errorType) {
+			return fmt.Errorf("di: constructor's second return value must be error, got %v", ft.Out(1))
+		}
+	default:
+		return fmt.Errorf("di: constructor must return (T) or (T, error), got %d return values", ft.NumOut())
+	}
+	if !ft.Out(0).ConvertibleTo(t) {
+		return fmt.Errorf("di: %v cannot be converted to %v", ft.Out(0), t)
+	}
+	var once *sync.Once
+	var errp *error
+	if shared {
+		once = &sync.Once{}
+		errp = new(error)
+	}
+	c.bind(t, "", constructorBinding{fv, shared, once, errp})
+	return nil
+}
+
+func (c *container) Provide(fn interface{}) {
+	if err := c.ProvideE(fn); err != nil {
+		panic(err.Error())
+	}
+}
+
+func (c *container) ProvideE(fn interface{}) error {
+	ft := reflect.TypeOf(fn)
+	if ft == nil || ft.Kind() != reflect.Func || ft.NumOut() == 0 {
+		return fmt.Errorf("di: Provide requires a func with at least one return value, got %v", ft)
+	}
+	return c.RegisterConstructorE(fn, ft.Out(0), false)
 }
 
 func (c *container) Call(f interface{}) []interface{} {
-	t := reflect.TypeOf(f)
+	r, err := c.Invoke(f)
+	if err != nil {
+		panic(err.Error())
+	}
+	return r
+}
 
-	// will panic if t is not a func while calling NumIn()
-	var in = make([]reflect.Value, t.NumIn())
+func (c *container) Invoke(f interface{}) ([]interface{}, error) {
+	t := reflect.TypeOf(f)
+	if t == nil || t.Kind() != reflect.Func {
+		return nil, fmt.Errorf("di: Invoke requires a func, got %v", t)
+	}
 
+	in := make([]reflect.Value, t.NumIn())
 	for i := 0; i < t.NumIn(); i++ {
-		in[i] = c.build(t.In(i))
+		v, err := c.buildNamedE(t.In(i), "", fmt.Sprintf("param%d", i), nil)
+		if err != nil {
+			return nil, err
+		}
+		in[i] = v
 	}
 
 	s := reflect.ValueOf(f).Call(in)
 
-	r := make([]interface{}, 0)
+	r := make([]interface{}, 0, len(s))
 	for _, rv := range s {
 		r = append(r, rv.Interface())
 	}
-	return r
+	return r, nil
 }
 
 func (c *container) Make(t reflect.Type) interface{} {
-	return c.build(t).Interface()
+	return c.buildNamed(t, "", nil).Interface()
+}
+
+func (c *container) MakeE(t reflect.Type) (interface{}, error) {
+	v, err := c.buildNamedE(t, "", "", nil)
+	if err != nil {
+		return nil, err
+	}
+	return v.Interface(), nil
+}
+
+func (c *container) MakeNamed(name string, t reflect.Type) interface{} {
+	return c.buildNamed(t, name, nil).Interface()
 }
 
 func (c *container) Inject(val interface{}) {
-	c.inject(reflect.ValueOf(val))
+	c.inject(reflect.ValueOf(val), nil)
+}
+
+func (c *container) Apply(val interface{}) error {
+	v := reflect.ValueOf(val)
+	t := v.Type()
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return c.injectE(v, t.Name(), nil)
 }
 
 func (c *container) build(t reflect.Type) reflect.Value {
-	if val, ok := c.values[t]; ok {
+	return c.buildNamed(t, "", nil)
+}
+
+// buildNamed resolves t's binding named name, falling back to building a zero value from
+// scratch when nothing is registered. stack holds the types currently being built from scratch
+// or constructed further up this same top-level Make/Inject/Call; if t is already on stack,
+// resolving it again would recurse forever, so buildNamed panics with a *CycleError describing
+// the chain instead. Merely following an interface binding, a parent container, or the
+// pointer/value duality of a registered type is not itself a cycle, so stack only grows at the
+// two points that actually recurse into caller-controlled code: building an unregistered struct
+// and invoking a constructor.
+func (c *container) buildNamed(t reflect.Type, name string, stack []reflect.Type) reflect.Value {
+	if val, ok := c.lookup(t, name); ok {
 		switch val.(type) {
 		case reflect.Type: // type mapped to interface
-			return c.build(val.(reflect.Type))
+			return c.buildNamed(val.(reflect.Type), name, stack)
 		case providerBinding: // type mapped to provider func
 			fb := val.(providerBinding)
 			if !fb.shared {
 				return fb.provider(c)
 			}
-			v := fb.provider(c)
-			c.values[t] = v
-			return v
+			fb.once.Do(func() {
+				c.bind(t, name, fb.provider(c))
+			})
+			bound, _ := c.lookup(t, name)
+			return bound.(reflect.Value)
+		case constructorBinding: // type mapped to constructor func
+			if ce := cycleIn(stack, t); ce != nil {
+				panic(ce.Error())
+			}
+			cb := val.(constructorBinding)
+			if !cb.shared {
+				v, err := c.invokeConstructor(cb, t.String(), append(stack, t))
+				if err != nil {
+					panic(err.Error())
+				}
+				return v
+			}
+			cb.once.Do(func() {
+				v, err := c.invokeConstructor(cb, t.String(), append(stack, t))
+				if err != nil {
+					*cb.errp = err
+					return
+				}
+				c.bind(t, name, v)
+			})
+			if *cb.errp != nil {
+				panic((*cb.errp).Error())
+			}
+			bound, _ := c.lookup(t, name)
+			return bound.(reflect.Value)
 		default: // type mapped to instance value
 			return val.(reflect.Value)
 		}
 	}
 
 	// no mapping found, try parent container, if any
-	if c.parent != nil {
-		return c.parent.(*container).build(t)
+	if p := c.parentOf(); p != nil {
+		return p.buildNamed(t, name, stack)
 	}
 
 	// try the pointer version
 	ptr := reflect.PtrTo(t)
-	if _, ok := c.values[ptr]; ok {
-		return c.build(ptr).Elem()
+	if _, ok := c.lookup(ptr, name); ok {
+		return c.buildNamed(ptr, name, stack).Elem()
 	}
 
 	// build from scratch
 	switch t.Kind() {
 	case reflect.Struct:
+		if ce := cycleIn(stack, t); ce != nil {
+			panic(ce.Error())
+		}
 		r := reflect.New(t)
-		c.inject(r)
+		c.inject(r, append(stack, t))
 		return r.Elem()
 	case reflect.Slice:
 		return reflect.MakeSlice(t, 0, 0)
@@ -243,14 +638,14 @@ func (c *container) build(t reflect.Type) reflect.Value {
 	case reflect.Chan:
 		return reflect.MakeChan(t, 0)
 	case reflect.Ptr:
-		if v := c.build(t.Elem()); v.CanAddr() {
+		if v := c.buildNamed(t.Elem(), name, stack); v.CanAddr() {
 			return v.Addr()
 		}
 	}
 	return reflect.New(t).Elem()
 }
 
-func (c *container) inject(v reflect.Value) {
+func (c *container) inject(v reflect.Value, stack []reflect.Type) {
 	for v.Kind() == reflect.Ptr {
 		v = v.Elem()
 	}
@@ -263,8 +658,175 @@ func (c *container) inject(v reflect.Value) {
 	for i := 0; i < v.NumField(); i++ {
 		f := v.Field(i)
 		tf := t.Field(i)
-		if f.CanSet() && tf.Tag.Get(injectTag) != "" {
-			f.Set(c.build(f.Type()))
+		if tag := tf.Tag.Get(injectTag); f.CanSet() && tag != "" {
+			name := bindingName(tag)
+			if isLazyFactory(f.Type()) {
+				f.Set(c.lazyFactory(f.Type(), name))
+				continue
+			}
+			f.Set(c.buildNamed(f.Type(), name, stack))
+		}
+	}
+}
+
+// buildE is the error-returning counterpart of build. It mirrors build's resolution order
+// exactly, except that a type which cannot be resolved because it is an unregistered interface
+// is reported as a *ResolveError instead of silently falling back to a nil value. path is the
+// dotted field path being resolved so far, and is threaded into any *ResolveError produced while
+// resolving a nested struct field; it is empty when t is the type originally requested.
+func (c *container) buildE(t reflect.Type, path string) (reflect.Value, error) {
+	return c.buildNamedE(t, "", path, nil)
+}
+
+// buildNamedE is the error-returning counterpart of buildNamed; see buildE for the semantics of
+// path and buildNamed for the semantics of stack. A cycle is reported as a *CycleError rather
+// than the *ResolveError used for an ordinary unresolved interface.
+func (c *container) buildNamedE(t reflect.Type, name string, path string, stack []reflect.Type) (reflect.Value, error) {
+	if val, ok := c.lookup(t, name); ok {
+		switch val.(type) {
+		case reflect.Type: // type mapped to interface
+			return c.buildNamedE(val.(reflect.Type), name, path, stack)
+		case providerBinding: // type mapped to provider func
+			fb := val.(providerBinding)
+			if !fb.shared {
+				return fb.provider(c), nil
+			}
+			fb.once.Do(func() {
+				c.bind(t, name, fb.provider(c))
+			})
+			bound, _ := c.lookup(t, name)
+			return bound.(reflect.Value), nil
+		case constructorBinding: // type mapped to constructor func
+			if ce := cycleIn(stack, t); ce != nil {
+				return reflect.Value{}, ce
+			}
+			cb := val.(constructorBinding)
+			if !cb.shared {
+				return c.invokeConstructor(cb, path, append(stack, t))
+			}
+			cb.once.Do(func() {
+				v, err := c.invokeConstructor(cb, path, append(stack, t))
+				if err != nil {
+					*cb.errp = err
+					return
+				}
+				c.bind(t, name, v)
+			})
+			if *cb.errp != nil {
+				return reflect.Value{}, *cb.errp
+			}
+			bound, _ := c.lookup(t, name)
+			return bound.(reflect.Value), nil
+		default: // type mapped to instance value
+			return val.(reflect.Value), nil
 		}
 	}
+
+	// no mapping found, try parent container, if any
+	if p := c.parentOf(); p != nil {
+		return p.buildNamedE(t, name, path, stack)
+	}
+
+	// try the pointer version
+	ptr := reflect.PtrTo(t)
+	if _, ok := c.lookup(ptr, name); ok {
+		v, err := c.buildNamedE(ptr, name, path, stack)
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		return v.Elem(), nil
+	}
+
+	// build from scratch
+	switch t.Kind() {
+	case reflect.Struct:
+		if ce := cycleIn(stack, t); ce != nil {
+			return reflect.Value{}, ce
+		}
+		r := reflect.New(t)
+		if err := c.injectE(r, path, append(stack, t)); err != nil {
+			return reflect.Value{}, err
+		}
+		return r.Elem(), nil
+	case reflect.Slice:
+		return reflect.MakeSlice(t, 0, 0), nil
+	case reflect.Map:
+		return reflect.MakeMap(t), nil
+	case reflect.Chan:
+		return reflect.MakeChan(t, 0), nil
+	case reflect.Ptr:
+		v, err := c.buildNamedE(t.Elem(), name, path, stack)
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		if v.CanAddr() {
+			return v.Addr(), nil
+		}
+	case reflect.Interface:
+		return reflect.Value{}, &ResolveError{Type: t, Path: path, Reason: "no binding and type is interface"}
+	}
+	return reflect.New(t).Elem(), nil
+}
+
+// injectE is the error-returning counterpart of inject. path is the dotted field path of v
+// itself (e.g. "Controller"), and is extended with each field's name when recursing into
+// buildNamedE, so that a failure deep within a struct can be reported against the full chain of
+// field names that led to it (e.g. "Controller.Request.Bar").
+func (c *container) injectE(v reflect.Value, path string, stack []reflect.Type) error {
+	for v.Kind() == reflect.Ptr {
+		v = v.Elem()
+	}
+
+	if v.Kind() != reflect.Struct {
+		return nil
+	}
+
+	t := v.Type()
+	for i := 0; i < v.NumField(); i++ {
+		f := v.Field(i)
+		tf := t.Field(i)
+		tag := tf.Tag.Get(injectTag)
+		if f.CanSet() && tag != "" {
+			name := bindingName(tag)
+			if isLazyFactory(f.Type()) {
+				f.Set(c.lazyFactory(f.Type(), name))
+				continue
+			}
+			fieldPath := tf.Name
+			if path != "" {
+				fieldPath = path + "." + tf.Name
+			}
+			fv, err := c.buildNamedE(f.Type(), name, fieldPath, stack)
+			if err != nil {
+				return err
+			}
+			f.Set(fv)
+		}
+	}
+	return nil
+}
+
+// invokeConstructor resolves cb.fn's parameters from the container, exactly as Invoke does for
+// Call, then invokes cb.fn and returns its result. If cb.fn returns (T, error) and the error is
+// non-nil, that error is returned instead.
+func (c *container) invokeConstructor(cb constructorBinding, path string, stack []reflect.Type) (reflect.Value, error) {
+	ft := cb.fn.Type()
+	in := make([]reflect.Value, ft.NumIn())
+	for i := 0; i < ft.NumIn(); i++ {
+		paramPath := fmt.Sprintf("param%d", i)
+		if path != "" {
+			paramPath = path + "." + paramPath
+		}
+		v, err := c.buildNamedE(ft.In(i), "", paramPath, stack)
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		in[i] = v
+	}
+
+	out := cb.fn.Call(in)
+	if len(out) == 2 && !out[1].IsNil() {
+		return reflect.Value{}, out[1].Interface().(error)
+	}
+	return out[0], nil
 }
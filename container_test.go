@@ -5,7 +5,11 @@
 package di
 
 import (
+	"errors"
 	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 )
 
@@ -424,3 +428,415 @@ func TestInterfaceOf(t *testing.T) {
 	}()
 	InterfaceOf(reflect.TypeOf(Foo{}))
 }
+
+func TestMakeE(t *testing.T) {
+	c := NewContainer()
+
+	foo, err := c.MakeE(reflect.TypeOf(Foo{}))
+	if err != nil {
+		t.Errorf("MakeE(Foo) returned error %v, expected nil", err)
+	}
+	if foo.(Foo).a != "" {
+		t.Errorf("MakeE(Foo).a = %q, expected empty", foo.(Foo).a)
+	}
+
+	barType := InterfaceOf((*Bar)(nil))
+	if _, err := c.MakeE(barType); err == nil {
+		t.Error("MakeE(Bar) should return an error when Bar is not registered")
+	} else if _, ok := err.(*ResolveError); !ok {
+		t.Errorf("MakeE(Bar) error = %T, expected *ResolveError", err)
+	}
+
+	c.RegisterAs(&Foo{"abc"}, barType)
+	bar, err := c.MakeE(barType)
+	if err != nil {
+		t.Errorf("MakeE(Bar) returned error %v, expected nil", err)
+	}
+	if bar.(*Foo).a != "abc" {
+		t.Errorf("MakeE(Bar).a = %q, expected %q", bar.(*Foo).a, "abc")
+	}
+}
+
+func TestApply(t *testing.T) {
+	writerType := InterfaceOf((*Writer)(nil))
+
+	c := NewContainer()
+	c.Register(&Context{"abc"})
+	c.RegisterAs(&ResponseWriter{t: 123}, writerType)
+	c.RegisterAs(&Foo{"xyz"}, InterfaceOf((*Bar)(nil)))
+
+	con := &Controller{}
+	if err := c.Apply(con); err != nil {
+		t.Errorf("Apply(Controller) returned error %v, expected nil", err)
+	}
+	if con.data != "abc" {
+		t.Errorf("Controller.data = %q, expected %q", con.data, "abc")
+	}
+	if con.Request.Bar.(*Foo).a != "xyz" {
+		t.Errorf("Controller.Request.Bar.(*Foo).a = %q, expected %q", con.Request.Bar.(*Foo).a, "xyz")
+	}
+
+	// an unresolvable interface field should surface a ResolveError naming the field path
+	c2 := NewContainer()
+	con2 := &Controller{}
+	err := c2.Apply(con2)
+	if err == nil {
+		t.Fatal("Apply(Controller) should return an error when Response cannot be resolved")
+	}
+	re, ok := err.(*ResolveError)
+	if !ok {
+		t.Fatalf("Apply(Controller) error = %T, expected *ResolveError", err)
+	}
+	if re.Path != "Controller.Context" && re.Path != "Controller.Response" {
+		t.Errorf("ResolveError.Path = %q, expected a Controller field path", re.Path)
+	}
+}
+
+func TestInvoke(t *testing.T) {
+	writerType := InterfaceOf((*Writer)(nil))
+
+	c := NewContainer()
+	w := ResponseWriter{t: 1}
+	context := Context{"abc"}
+	c.RegisterAs(&w, writerType)
+	c.Register(&context)
+
+	f := func(cc *Context, w Writer, s string) (string, string, string) {
+		return cc.data, w.Write("test"), s
+	}
+	result, err := c.Invoke(f)
+	if err != nil {
+		t.Errorf("Invoke(f) returned error %v, expected nil", err)
+	}
+	if len(result) != 3 || result[0] != "abc" || result[1] != "test" {
+		t.Errorf("Invoke(f) = %v, expected (%q, %q, %q)", result, "abc", "test", "")
+	}
+
+	if _, err := c.Invoke(123); err == nil {
+		t.Error("Invoke(123) should return an error, 123 is not a func")
+	}
+}
+
+func TestRegisterAsE(t *testing.T) {
+	var foo Foo
+	c := NewContainer()
+	writerType := InterfaceOf((*Writer)(nil))
+	if err := c.RegisterAsE(&foo, writerType); err == nil {
+		t.Error("RegisterAsE(&foo, writerType) should return an error, Foo does not implement Writer")
+	}
+
+	barType := InterfaceOf((*Bar)(nil))
+	if err := c.RegisterAsE(&foo, barType); err != nil {
+		t.Errorf("RegisterAsE(&foo, barType) returned error %v, expected nil", err)
+	}
+	if !c.HasRegistered(barType) {
+		t.Error("RegisterAsE(&foo, barType) failed, expected barType is registered")
+	}
+}
+
+func TestRegisterConstructor(t *testing.T) {
+	c := NewContainer()
+	c.Register(&Context{"abc"})
+
+	fooType := reflect.TypeOf(&Foo{})
+	c.RegisterConstructor(func(cc *Context) *Foo {
+		return &Foo{cc.data}
+	}, fooType, true)
+
+	foo1 := c.Make(fooType).(*Foo)
+	if foo1.a != "abc" {
+		t.Errorf("Make(*Foo).a = %q, expected %q", foo1.a, "abc")
+	}
+	foo1.a = "xyz"
+	foo2 := c.Make(fooType).(*Foo)
+	if foo2.a != "xyz" {
+		t.Errorf("Shared constructor should only run once, Make(*Foo).a = %q, expected %q", foo2.a, "xyz")
+	}
+
+	// constructor returning (T, error)
+	c2 := NewContainer()
+	c2.RegisterConstructor(func() (*Foo, error) {
+		return nil, errors.New("boom")
+	}, fooType, false)
+	if _, err := c2.MakeE(fooType); err == nil {
+		t.Error("MakeE(*Foo) should return the constructor's error")
+	}
+
+	c3 := NewContainer()
+	if err := c3.RegisterConstructorE(123, fooType, false); err == nil {
+		t.Error("RegisterConstructorE(123, ...) should return an error, 123 is not a func")
+	}
+}
+
+func TestProvide(t *testing.T) {
+	c := NewContainer()
+	c.Register(&Context{"abc"})
+
+	c.Provide(func(cc *Context) *Foo {
+		return &Foo{cc.data}
+	})
+
+	foo := c.Make(reflect.TypeOf(&Foo{})).(*Foo)
+	if foo.a != "abc" {
+		t.Errorf("Make(*Foo).a = %q, expected %q", foo.a, "abc")
+	}
+
+	if err := c.ProvideE(123); err == nil {
+		t.Error("ProvideE(123) should return an error, 123 is not a func")
+	}
+}
+
+func TestRegisterNamed(t *testing.T) {
+	c := NewContainer()
+	c.RegisterNamed("primary", &Foo{"primary"})
+	c.RegisterNamed("replica", &Foo{"replica"})
+	c.Register(&Foo{"default"})
+
+	if foo := c.MakeNamed("primary", reflect.TypeOf(&Foo{})).(*Foo); foo.a != "primary" {
+		t.Errorf("MakeNamed(primary).a = %q, expected %q", foo.a, "primary")
+	}
+	if foo := c.MakeNamed("replica", reflect.TypeOf(&Foo{})).(*Foo); foo.a != "replica" {
+		t.Errorf("MakeNamed(replica).a = %q, expected %q", foo.a, "replica")
+	}
+	if foo := c.Make(reflect.TypeOf(&Foo{})).(*Foo); foo.a != "default" {
+		t.Errorf("Make().a = %q, expected %q", foo.a, "default")
+	}
+
+	// an unregistered name builds from scratch, just like an unregistered type
+	if foo := c.MakeNamed("missing", reflect.TypeOf(&Foo{})).(*Foo); foo.a != "" {
+		t.Errorf("MakeNamed(missing).a = %q, expected empty", foo.a)
+	}
+}
+
+func TestRegisterAsNamed(t *testing.T) {
+	barType := InterfaceOf((*Bar)(nil))
+	c := NewContainer()
+	c.RegisterAsNamed("primary", &Foo{"primary"}, barType)
+	c.RegisterAsNamed("replica", &Foo{"replica"}, barType)
+
+	// only named bindings were registered, so the default (unnamed) slot stays empty
+	if c.HasRegistered(barType) {
+		t.Error("HasRegistered(Bar) = true, expected false, only named bindings were registered")
+	}
+
+	bar := c.MakeNamed("primary", barType).(Bar)
+	if bar.test(0) != "primary" {
+		t.Errorf("MakeNamed(primary, Bar).test(0) = %q, expected %q", bar.test(0), "primary")
+	}
+}
+
+func TestInjectNamed(t *testing.T) {
+	type DB struct {
+		Primary Bar `inject:"primary"`
+		Replica Bar `inject:"replica"`
+	}
+
+	barType := InterfaceOf((*Bar)(nil))
+	c := NewContainer()
+	c.RegisterAsNamed("primary", &Foo{"primary"}, barType)
+	c.RegisterAsNamed("replica", &Foo{"replica"}, barType)
+
+	db := &DB{}
+	c.Inject(db)
+	if db.Primary.test(0) != "primary" {
+		t.Errorf("DB.Primary.test(0) = %q, expected %q", db.Primary.test(0), "primary")
+	}
+	if db.Replica.test(0) != "replica" {
+		t.Errorf("DB.Replica.test(0) = %q, expected %q", db.Replica.test(0), "replica")
+	}
+}
+
+type cyclicA struct {
+	B *cyclicB `inject:"true"`
+}
+
+type cyclicB struct {
+	A *cyclicA `inject:"true"`
+}
+
+func TestCycleDetection(t *testing.T) {
+	defer func() {
+		r := recover()
+		if r == nil {
+			t.Fatal("Make(cyclicA) did not panic, expected a cycle panic")
+		}
+		msg, ok := r.(string)
+		if !ok {
+			t.Fatalf("recovered %T, expected a string panic from CycleError", r)
+		}
+		if !strings.Contains(msg, "cycle detected") || !strings.Contains(msg, "cyclicA") || !strings.Contains(msg, "cyclicB") {
+			t.Errorf("panic = %q, expected it to mention the cyclicA -> cyclicB cycle", msg)
+		}
+	}()
+
+	c := NewContainer()
+	c.Make(reflect.TypeOf(&cyclicA{}))
+}
+
+func TestCycleDetectionE(t *testing.T) {
+	c := NewContainer()
+	_, err := c.MakeE(reflect.TypeOf(&cyclicA{}))
+	if err == nil {
+		t.Fatal("MakeE(cyclicA) returned nil error, expected a *CycleError")
+	}
+	ce, ok := err.(*CycleError)
+	if !ok {
+		t.Fatalf("MakeE(cyclicA) error = %T, expected *CycleError", err)
+	}
+	if !strings.Contains(ce.Error(), "cycle detected") {
+		t.Errorf("CycleError.Error() = %q, expected it to mention the cycle", ce.Error())
+	}
+}
+
+type diamondD struct {
+	v string
+}
+
+type diamondB struct {
+	D *diamondD `inject:"true"`
+}
+
+type diamondC struct {
+	D *diamondD `inject:"true"`
+}
+
+type diamondA struct {
+	B *diamondB `inject:"true"`
+	C *diamondC `inject:"true"`
+}
+
+// TestDiamondDependency ensures that resolving the same type twice via independent sibling
+// branches of a dependency graph (not a genuine cycle) still succeeds.
+func TestDiamondDependency(t *testing.T) {
+	c := NewContainer()
+	a := c.Make(reflect.TypeOf(&diamondA{})).(*diamondA)
+	if a.B == nil || a.B.D == nil || a.C == nil || a.C.D == nil {
+		t.Fatal("Make(diamondA) left some fields nil, expected a fully built diamond")
+	}
+}
+
+// TestConcurrentMake hammers a single container from many goroutines, both resolving a shared
+// provider and building an unregistered struct, to catch data races on the container's internal
+// map (run with -race) and to verify the shared provider runs exactly once.
+func TestConcurrentMake(t *testing.T) {
+	var calls int32
+	barType := InterfaceOf((*Bar)(nil))
+
+	c := NewContainer()
+	c.RegisterProvider(func(Container) reflect.Value {
+		atomic.AddInt32(&calls, 1)
+		return reflect.ValueOf(&Foo{"shared"})
+	}, barType, true)
+
+	const n = 100
+	var wg sync.WaitGroup
+	wg.Add(n)
+	for i := 0; i < n; i++ {
+		go func() {
+			defer wg.Done()
+			bar := c.Make(barType).(Bar)
+			if bar.test(0) != "shared" {
+				t.Errorf("Make(Bar).test(0) = %q, expected %q", bar.test(0), "shared")
+			}
+			c.Make(reflect.TypeOf(&Foo{}))
+		}()
+	}
+	wg.Wait()
+
+	if calls != 1 {
+		t.Errorf("shared provider called %d times, expected exactly 1", calls)
+	}
+}
+
+type lazyLogger struct {
+	n int
+}
+
+type lazyLoggerUser struct {
+	Logger func() *lazyLogger `inject:"true"`
+}
+
+// TestLazyFactoryField verifies that a func() T inject-tagged field is lazy: the underlying
+// provider only runs once the returned func is actually called, and a non-shared provider still
+// runs again on every call just as it would for a directly-typed field.
+func TestLazyFactoryField(t *testing.T) {
+	var calls int
+	c := NewContainer()
+	c.RegisterProvider(func(Container) reflect.Value {
+		calls++
+		return reflect.ValueOf(&lazyLogger{n: calls})
+	}, reflect.TypeOf(&lazyLogger{}), false)
+
+	u := c.Make(reflect.TypeOf(&lazyLoggerUser{})).(*lazyLoggerUser)
+	if calls != 0 {
+		t.Fatalf("provider called %d times before the factory was invoked, expected 0", calls)
+	}
+
+	l1 := u.Logger()
+	if calls != 1 || l1.n != 1 {
+		t.Fatalf("after 1st call: calls = %d, l1.n = %d, expected 1, 1", calls, l1.n)
+	}
+
+	l2 := u.Logger()
+	if calls != 2 || l2.n != 2 {
+		t.Fatalf("after 2nd call: calls = %d, l2.n = %d, expected 2, 2", calls, l2.n)
+	}
+}
+
+type cyclicLazyA struct {
+	B func() *cyclicLazyB `inject:"true"`
+}
+
+type cyclicLazyB struct {
+	A *cyclicLazyA `inject:"true"`
+}
+
+// TestLazyFactoryBreaksCycle verifies that a func() T field is not built along with the rest of
+// the struct, so a pair of types that reference each other no longer stack-overflows as long as
+// one side of the reference is a lazy factory.
+func TestLazyFactoryBreaksCycle(t *testing.T) {
+	c := NewContainer()
+	a := c.Make(reflect.TypeOf(&cyclicLazyA{})).(*cyclicLazyA)
+	if a.B == nil {
+		t.Fatal("a.B is nil, expected a lazy factory func")
+	}
+
+	b := a.B()
+	if b == nil || b.A == nil {
+		t.Fatal("a.B().A is nil, expected a fully built *cyclicLazyA")
+	}
+	if b.A.B == nil {
+		t.Fatal("a.B().A.B is nil, expected another (uninvoked) lazy factory func")
+	}
+}
+
+type lazyFactoryErrField struct {
+	Bar func() (Bar, error) `inject:"true"`
+}
+
+// TestLazyFactoryFieldError verifies that a func() (T, error) field surfaces a resolution failure
+// as its error return instead of panicking or silently zero-filling.
+func TestLazyFactoryFieldError(t *testing.T) {
+	c := NewContainer()
+	ef := c.Make(reflect.TypeOf(&lazyFactoryErrField{})).(*lazyFactoryErrField)
+
+	bar, err := ef.Bar()
+	if err == nil {
+		t.Fatal("Bar() returned a nil error, expected a *ResolveError for the unregistered interface")
+	}
+	if _, ok := err.(*ResolveError); !ok {
+		t.Errorf("Bar() error = %T, expected *ResolveError", err)
+	}
+	if bar != nil {
+		t.Errorf("Bar() = %v, expected nil on error", bar)
+	}
+
+	c.RegisterAs(&Foo{"xyz"}, InterfaceOf((*Bar)(nil)))
+	bar, err = ef.Bar()
+	if err != nil {
+		t.Fatalf("Bar() returned error %v, expected nil once Bar was registered", err)
+	}
+	if bar.test(0) != "xyz" {
+		t.Errorf("Bar().test(0) = %q, expected %q", bar.test(0), "xyz")
+	}
+}